@@ -0,0 +1,157 @@
+// Package crawldb persists per-URL crawl state in an embedded BoltDB file
+// so a crawl can be interrupted and resumed without re-fetching URLs it
+// has already completed, and so URLs fetched recently can be skipped
+// within a configurable freshness window.
+package crawldb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var urlsBucket = []byte("urls")
+
+// Status records where a URL stands in the crawl lifecycle.
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusFetching Status = "fetching"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+)
+
+// Record is the persisted state for a single URL.
+type Record struct {
+	URL         string    `json:"url"`
+	Status      Status    `json:"status"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	ContentHash string    `json:"content_hash"`
+	LastMod     string    `json:"last_mod"`
+}
+
+// DB wraps a BoltDB file tracking every URL a crawl has seen.
+type DB struct {
+	bolt *bolt.DB
+}
+
+// Open opens (creating if necessary) the crawl database at path.
+func Open(path string) (*DB, error) {
+	b, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("crawldb: open %s: %w", path, err)
+	}
+
+	err = b.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(urlsBucket)
+		return err
+	})
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("crawldb: init bucket: %w", err)
+	}
+
+	return &DB{bolt: b}, nil
+}
+
+// Close closes the underlying database file.
+func (d *DB) Close() error {
+	return d.bolt.Close()
+}
+
+// Get returns the stored record for url, if one exists.
+func (d *DB) Get(url string) (Record, bool, error) {
+	var rec Record
+	var found bool
+
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(urlsBucket).Get([]byte(url))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &rec)
+	})
+	return rec, found, err
+}
+
+func (d *DB) put(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).Put([]byte(rec.URL), data)
+	})
+}
+
+// MarkQueued records that url has been handed to a worker but not yet
+// completed, so a crash mid-fetch leaves a trail to resume from.
+func (d *DB) MarkQueued(url string) error {
+	return d.put(Record{URL: url, Status: StatusQueued})
+}
+
+// MarkDone records a successful fetch of url at fetchedAt, along with a
+// hash of its content and the sitemap-declared lastMod (if any) in
+// effect at fetch time, so later crawls can detect unchanged pages
+// either by content hash or by an unchanged lastmod.
+func (d *DB) MarkDone(url, contentHash, lastMod string, fetchedAt time.Time) error {
+	return d.put(Record{URL: url, Status: StatusDone, FetchedAt: fetchedAt, ContentHash: contentHash, LastMod: lastMod})
+}
+
+// MarkFailed records that fetching url failed.
+func (d *DB) MarkFailed(url string) error {
+	return d.put(Record{URL: url, Status: StatusFailed})
+}
+
+// Fresh reports whether url was successfully fetched more recently than
+// window before now, meaning the caller may skip re-fetching it.
+func (d *DB) Fresh(url string, window time.Duration, now time.Time) (bool, error) {
+	rec, found, err := d.Get(url)
+	if err != nil || !found || rec.Status != StatusDone {
+		return false, err
+	}
+	return now.Sub(rec.FetchedAt) < window, nil
+}
+
+// Unchanged reports whether url's sitemap-declared lastMod matches the
+// one recorded at its last successful fetch, meaning the page is known
+// not to have changed since and may be skipped regardless of how long
+// ago that fetch was. An empty lastMod (the sitemap published none)
+// never counts as unchanged.
+func (d *DB) Unchanged(url, lastMod string) (bool, error) {
+	if lastMod == "" {
+		return false, nil
+	}
+
+	rec, found, err := d.Get(url)
+	if err != nil || !found || rec.Status != StatusDone {
+		return false, err
+	}
+	return rec.LastMod == lastMod, nil
+}
+
+// PendingURLs returns every URL left in the "queued" or "fetching" state
+// by a prior run. A killed process leaves these in flight, so they must
+// be re-queued on resume rather than assumed complete.
+func (d *DB) PendingURLs() ([]string, error) {
+	var pending []string
+
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).ForEach(func(k, v []byte) error {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if rec.Status == StatusQueued || rec.Status == StatusFetching {
+				pending = append(pending, rec.URL)
+			}
+			return nil
+		})
+	})
+	return pending, err
+}
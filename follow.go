@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// crawlJob describes one unit of work for the worker pool: a URL to
+// fetch, how many hops it is from its seed, and (in -follow mode) the
+// page that linked to it. Seed jobs built from a sitemap carry along
+// whatever <lastmod>/<changefreq>/<priority>/<image:image>/<news:news>
+// metadata the sitemap published for the URL; jobs discovered by
+// following links leave these zero.
+type crawlJob struct {
+	URL        string
+	Depth      int
+	Referrer   string
+	LastMod    string
+	ChangeFreq string
+	Priority   string
+	Images     []string
+	NewsTitle  string
+}
+
+// jobQueue is an unbounded, concurrency-safe FIFO queue of crawlJobs.
+// Workers discovering new links in -follow mode push back into the same
+// queue they read from; a fixed-size channel would deadlock once enough
+// workers blocked trying to push while the channel was full, so the
+// queue grows a backing slice instead of blocking on Push.
+type jobQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []crawlJob
+	closed bool
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push appends job to the queue and wakes one blocked Pop, if any.
+func (q *jobQueue) Push(job crawlJob) {
+	q.mu.Lock()
+	q.items = append(q.items, job)
+	q.mu.Unlock()
+	q.cond.Signal()
+	queueDepth.Inc()
+}
+
+// Close marks the queue as drained. Blocked and future Pop calls return
+// ok=false once there's nothing left to hand out.
+func (q *jobQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// Pop blocks until a job is available or the queue is closed and empty.
+func (q *jobQueue) Pop() (crawlJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return crawlJob{}, false
+	}
+
+	job := q.items[0]
+	q.items = q.items[1:]
+	queueDepth.Dec()
+	return job, true
+}
+
+// FollowConfig governs -follow mode: how deep to chase links, which
+// schemes and URLs are in scope, and which URLs have already been
+// queued so the same page isn't fetched twice.
+type FollowConfig struct {
+	MaxDepth int
+	Schemes  map[string]bool
+	Scope    *regexp.Regexp // nil means "same host as the seed"
+	seedHost string
+	visited  sync.Map // normalized URL -> struct{}
+}
+
+// NewFollowConfig builds a FollowConfig from the -depth/-schemes/-scope
+// flag values, scoping same-host matches to seedURL's host.
+func NewFollowConfig(seedURL string, maxDepth int, schemesCSV, scopePattern string) (*FollowConfig, error) {
+	seed, err := url.Parse(seedURL)
+	if err != nil {
+		return nil, fmt.Errorf("follow: parse seed url: %w", err)
+	}
+
+	schemes := make(map[string]bool)
+	for _, s := range strings.Split(schemesCSV, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			schemes[s] = true
+		}
+	}
+
+	var scope *regexp.Regexp
+	if scopePattern != "" {
+		scope, err = regexp.Compile(scopePattern)
+		if err != nil {
+			return nil, fmt.Errorf("follow: compile -scope: %w", err)
+		}
+	}
+
+	return &FollowConfig{
+		MaxDepth: maxDepth,
+		Schemes:  schemes,
+		Scope:    scope,
+		seedHost: seed.Host,
+	}, nil
+}
+
+// InScope reports whether u's scheme and host/path satisfy the allowed
+// schemes and scope rules.
+func (f *FollowConfig) InScope(u *url.URL) bool {
+	if !f.Schemes[u.Scheme] {
+		return false
+	}
+	if f.Scope != nil {
+		return f.Scope.MatchString(u.String())
+	}
+	return u.Host == f.seedHost
+}
+
+// Visit marks key as queued, returning true the first time it's seen so
+// callers only enqueue each normalized URL once.
+func (f *FollowConfig) Visit(key string) bool {
+	_, loaded := f.visited.LoadOrStore(key, struct{}{})
+	return !loaded
+}
+
+var cssURLPattern = regexp.MustCompile(`url\(\s*['"]?([^'")]+)['"]?\s*\)`)
+
+// extractLinks walks an HTML document for <a href>, <img src>, <link
+// href>, and CSS url(...) references (inline style attributes and
+// <style> blocks), resolving each against base.
+func extractLinks(body []byte, base *url.URL) []*url.URL {
+	var refs []string
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err == nil {
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode {
+				switch n.Data {
+				case "a", "link":
+					for _, a := range n.Attr {
+						if a.Key == "href" {
+							refs = append(refs, a.Val)
+						}
+					}
+				case "img":
+					for _, a := range n.Attr {
+						if a.Key == "src" {
+							refs = append(refs, a.Val)
+						}
+					}
+				case "style":
+					if n.FirstChild != nil {
+						refs = append(refs, cssURLs(n.FirstChild.Data)...)
+					}
+				}
+				for _, a := range n.Attr {
+					if a.Key == "style" {
+						refs = append(refs, cssURLs(a.Val)...)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+	}
+
+	seen := make(map[string]bool)
+	var resolved []*url.URL
+	for _, raw := range refs {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+
+		ref, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+
+		u := base.ResolveReference(ref)
+		if seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		resolved = append(resolved, u)
+	}
+	return resolved
+}
+
+func cssURLs(css string) []string {
+	var out []string
+	for _, m := range cssURLPattern.FindAllStringSubmatch(css, -1) {
+		out = append(out, m[1])
+	}
+	return out
+}
+
+// normalizeURL returns the dedup key for u: its string form with any
+// fragment stripped, since #anchors don't identify a distinct resource.
+func normalizeURL(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	v.RawFragment = ""
+	return v.String()
+}
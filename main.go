@@ -1,19 +1,24 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"net/http"
-	"os"
+	neturl "net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/tejanshsachdeva/web-crawler/crawldb"
 	"golang.org/x/net/html"
 )
 
@@ -23,17 +28,49 @@ type CrawlResult struct {
 	Title           string
 	MetaDescription string
 	Canonical       string
+	ContentType     string
+	SHA256          string
+	Body            []byte
+	FetchedAt       time.Time
+	LastMod         string
+	ChangeFreq      string
+	Priority        string
+	Images          []string
+	NewsTitle       string
+	Referrer        string
+}
+
+// sitemapEntry is one discovered URL together with whatever optional
+// sitemap metadata it was published with. Plain-text sitemaps produce
+// entries with only URL set.
+type sitemapEntry struct {
+	URL        string
+	LastMod    string
+	ChangeFreq string
+	Priority   string
+	Images     []string
+	NewsTitle  string
 }
 
 type urlSet struct {
 	URLs []struct {
-		Loc string `xml:"loc"`
+		Loc        string `xml:"loc"`
+		LastMod    string `xml:"lastmod"`
+		ChangeFreq string `xml:"changefreq"`
+		Priority   string `xml:"priority"`
+		Images     []struct {
+			Loc string `xml:"loc"`
+		} `xml:"image"`
+		News *struct {
+			Title string `xml:"title"`
+		} `xml:"news"`
 	} `xml:"url"`
 }
 
 type siteMapIndex struct {
 	Sitemaps []struct {
-		Loc string `xml:"loc"`
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
 	} `xml:"sitemap"`
 }
 
@@ -52,47 +89,93 @@ func randomUserAgent() string {
 	return userAgents[rand.Intn(len(userAgents))]
 }
 
-func makeRequest(url string) ([]byte, string, int, error) {
-	log.Println("REQUEST:", url)
+// makeRequest fetches url and emits a single structured log event plus
+// Prometheus observations covering the whole attempt, however it ends.
+// workerID identifies the pool worker driving the fetch (-1 for fetches
+// made outside the worker pool, e.g. the initial sitemap or a robots.txt
+// lookup); attempt is the 1-based retry count.
+func makeRequest(url string, warcWriter *WarcWriter, workerID, attempt int) (body []byte, contentType string, status int, err error) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		recordRequestMetrics(status, len(body), duration)
+		logger.Info("request",
+			"url", url,
+			"method", "GET",
+			"status", status,
+			"content_type", contentType,
+			"bytes", len(body),
+			"duration_ms", duration.Milliseconds(),
+			"worker_id", workerID,
+			"attempt", attempt,
+			"error", err,
+		)
+	}()
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Println("REQUEST ERROR:", err)
-		return nil, "", 0, err
+	req, reqErr := http.NewRequest("GET", url, nil)
+	if reqErr != nil {
+		err = reqErr
+		return
 	}
 
-	req.Header.Set("User-Agent", randomUserAgent())
+	ua := randomUserAgent()
+	req.Header.Set("User-Agent", ua)
 	req.Header.Set("Accept", "application/xml,text/xml,text/html,*/*")
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		log.Println("HTTP ERROR:", url, err)
-		return nil, "", 0, err
+	var warcRequestID string
+	if warcWriter != nil {
+		id, werr := warcWriter.WriteRequest(url, ua)
+		if werr != nil {
+			logger.Warn("warc request write failed", "url", url, "error", werr)
+		}
+		warcRequestID = id
+	}
+
+	resp, doErr := httpClient.Do(req)
+	if doErr != nil {
+		err = doErr
+		return
 	}
 	defer resp.Body.Close()
 
-	ct := resp.Header.Get("Content-Type")
-	log.Println("RESPONSE:", url, "STATUS:", resp.StatusCode, "CT:", ct)
+	status = resp.StatusCode
+	contentType = resp.Header.Get("Content-Type")
+
+	raw, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		err = readErr
+		return
+	}
+
+	// The WARC record must preserve exactly what the server sent, headers
+	// and all (including the gzip Content-Length), so it archives raw
+	// before any decompression below. Decompressing first and archiving
+	// that instead would leave the record's Content-Length header
+	// describing bytes that no longer match the body that follows it.
+	if warcWriter != nil {
+		if werr := warcWriter.WriteResponse(url, warcRequestID, resp, raw); werr != nil {
+			logger.Warn("warc response write failed", "url", url, "error", werr)
+		}
+	}
 
-	var reader io.Reader = resp.Body
+	body = raw
 	if strings.HasSuffix(url, ".gz") {
-		log.Println("GZIP DETECTED:", url)
-		gz, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			log.Println("GZIP ERROR:", err)
-			return nil, ct, resp.StatusCode, err
+		gz, gzErr := gzip.NewReader(bytes.NewReader(raw))
+		if gzErr != nil {
+			err = gzErr
+			return
 		}
 		defer gz.Close()
-		reader = gz
-	}
 
-	body, err := io.ReadAll(reader)
-	if err != nil {
-		log.Println("READ ERROR:", err)
-		return nil, ct, resp.StatusCode, err
+		decoded, decErr := io.ReadAll(gz)
+		if decErr != nil {
+			err = decErr
+			return
+		}
+		body = decoded
 	}
 
-	return body, ct, resp.StatusCode, nil
+	return
 }
 
 func sanitizeXML(b []byte) []byte {
@@ -101,41 +184,109 @@ func sanitizeXML(b []byte) []byte {
 	return b
 }
 
-func extractURLsFromXML(data []byte) ([]string, error) {
-	var urls []string
+// defaultMaxSitemapDepth bounds how many sitemapindex hops
+// extractURLsFromXML will follow, so a misconfigured or malicious site
+// can't recurse forever even without a direct cycle.
+const defaultMaxSitemapDepth = 5
+
+// looksLikeXML sniffs data for a leading '<' (after whitespace and an
+// optional UTF-8 BOM), distinguishing urlset/sitemapindex XML from a
+// plain-text sitemap, which the sitemaps.org spec allows as one URL per
+// line.
+func looksLikeXML(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	return bytes.HasPrefix(trimmed, []byte("<"))
+}
+
+// parsePlainTextSitemap reads a plain-text sitemap, one URL per line,
+// ignoring blank lines.
+func parsePlainTextSitemap(data []byte) []sitemapEntry {
+	var entries []sitemapEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entries = append(entries, sitemapEntry{URL: line})
+	}
+	return entries
+}
+
+// extractURLsFromXML parses a sitemap body, which may be a urlset, a
+// sitemapindex, or (per content sniffing rather than falling through a
+// failed XML unmarshal) a plain-text list of URLs. depth is this call's
+// hop count from the root sitemap, maxDepth caps how many nested
+// sitemapindex levels it will follow, and visited records every child
+// sitemap URL already fetched so a sitemap that references itself
+// (directly or through a cycle of indexes) is only ever fetched once.
+func extractURLsFromXML(data []byte, warcWriter *WarcWriter, depth, maxDepth int, visited map[string]bool) ([]sitemapEntry, error) {
+	if !looksLikeXML(data) {
+		entries := parsePlainTextSitemap(data)
+		logger.Info("sitemap parsed", "type", "plain text", "urls", len(entries))
+		return entries, nil
+	}
 
 	var us urlSet
 	if xml.Unmarshal(data, &us) == nil && len(us.URLs) > 0 {
-		log.Println("SITEMAP TYPE: urlset | URLs:", len(us.URLs))
+		logger.Info("sitemap parsed", "type", "urlset", "urls", len(us.URLs))
+
+		entries := make([]sitemapEntry, 0, len(us.URLs))
 		for _, u := range us.URLs {
-			urls = append(urls, u.Loc)
+			entry := sitemapEntry{
+				URL:        u.Loc,
+				LastMod:    u.LastMod,
+				ChangeFreq: u.ChangeFreq,
+				Priority:   u.Priority,
+			}
+			for _, img := range u.Images {
+				entry.Images = append(entry.Images, img.Loc)
+			}
+			if u.News != nil {
+				entry.NewsTitle = u.News.Title
+			}
+			entries = append(entries, entry)
 		}
-		return urls, nil
+		return entries, nil
 	}
 
 	var si siteMapIndex
 	if xml.Unmarshal(data, &si) == nil && len(si.Sitemaps) > 0 {
-		log.Println("SITEMAP TYPE: index | CHILD SITEMAPS:", len(si.Sitemaps))
+		logger.Info("sitemap parsed", "type", "index", "child_sitemaps", len(si.Sitemaps))
+
+		if depth >= maxDepth {
+			logger.Warn("sitemap index max depth reached", "depth", depth)
+			return nil, nil
+		}
+
+		var entries []sitemapEntry
 		for _, sm := range si.Sitemaps {
-			log.Println("FOLLOW CHILD SITEMAP:", sm.Loc)
+			if visited[sm.Loc] {
+				logger.Debug("sitemap index cycle skipped", "sitemap_url", sm.Loc)
+				continue
+			}
+			visited[sm.Loc] = true
+
+			logger.Info("following child sitemap", "sitemap_url", sm.Loc)
 			time.Sleep(1 * time.Second)
 
-			childData, _, _, err := makeRequest(sm.Loc)
+			childData, _, _, err := makeRequest(sm.Loc, warcWriter, -1, 1)
 			if err != nil {
-				log.Println("CHILD FETCH FAILED:", sm.Loc)
+				logger.Warn("child sitemap fetch failed", "sitemap_url", sm.Loc, "error", err)
 				continue
 			}
 
 			childData = sanitizeXML(childData)
-			childURLs, err := extractURLsFromXML(childData)
+			childEntries, err := extractURLsFromXML(childData, warcWriter, depth+1, maxDepth, visited)
 			if err != nil {
-				log.Println("CHILD PARSE FAILED:", sm.Loc)
+				logger.Warn("child sitemap parse failed", "sitemap_url", sm.Loc, "error", err)
 				continue
 			}
 
-			urls = append(urls, childURLs...)
+			entries = append(entries, childEntries...)
 		}
-		return urls, nil
+		return entries, nil
 	}
 
 	return nil, fmt.Errorf("unsupported sitemap format")
@@ -144,7 +295,7 @@ func extractURLsFromXML(data []byte) ([]string, error) {
 func parseHTML(htmlBytes []byte) (string, string, string) {
 	doc, err := html.Parse(bytes.NewReader(htmlBytes))
 	if err != nil {
-		log.Println("HTML PARSE ERROR:", err)
+		logger.Warn("html parse error", "error", err)
 		return "", "", ""
 	}
 
@@ -193,105 +344,368 @@ func parseHTML(htmlBytes []byte) (string, string, string) {
 	return title, metaDesc, canonical
 }
 
-func worker(id int, jobs <-chan string, results chan<- CrawlResult, wg *sync.WaitGroup) {
-	defer wg.Done()
-	log.Println("WORKER STARTED:", id)
+// worker pulls jobs from queue until it's closed and drained. In -follow
+// mode, a completed job's discovered links are pushed back onto the same
+// queue (jobWG.Add before queue.Push, jobWG.Done after) rather than sent
+// on a fixed-size channel, so a page rich in links can never deadlock the
+// pool the way filling a bounded channel would.
+func worker(id int, queue *jobQueue, jobWG *sync.WaitGroup, results chan<- CrawlResult, warcWriter *WarcWriter, politeness *Politeness, db *crawldb.DB, follow *FollowConfig, force bool) {
+	logger.Info("worker started", "worker_id", id)
+
+	for {
+		job, ok := queue.Pop()
+		if !ok {
+			break
+		}
 
-	for url := range jobs {
-		log.Println("WORKER", id, "FETCHING:", url)
+		processJob(id, job, queue, jobWG, results, warcWriter, politeness, db, follow, force)
+		jobWG.Done()
+	}
 
-		body, ct, status, err := makeRequest(url)
+	logger.Info("worker stopped", "worker_id", id)
+}
+
+func processJob(id int, job crawlJob, queue *jobQueue, jobWG *sync.WaitGroup, results chan<- CrawlResult, warcWriter *WarcWriter, politeness *Politeness, db *crawldb.DB, follow *FollowConfig, force bool) {
+	url := job.URL
+
+	if !politeness.Allowed(url) {
+		logger.Info("robots disallowed", "worker_id", id, "url", url)
+		results <- CrawlResult{URL: url, Status: StatusRobotsDisallowed}
+		return
+	}
+
+	if db != nil && !force {
+		unchanged, err := db.Unchanged(url, job.LastMod)
 		if err != nil {
-			log.Println("WORKER", id, "FAILED:", url)
-			continue
+			logger.Warn("crawldb unchanged check error", "url", url, "error", err)
 		}
+		if unchanged {
+			logger.Debug("skipping unchanged url", "url", url, "last_mod", job.LastMod)
+			return
+		}
+	}
 
-		if !strings.Contains(ct, "text/html") {
-			results <- CrawlResult{URL: url, Status: status}
-			continue
+	release, err := politeness.Acquire(url)
+	if err != nil {
+		logger.Warn("politeness acquire failed", "worker_id", id, "url", url, "error", err)
+		return
+	}
+
+	body, ct, status, err := makeRequest(url, warcWriter, id, 1)
+	release()
+	if err != nil {
+		logger.Warn("fetch failed", "worker_id", id, "url", url, "error", err)
+		if db != nil {
+			if err := db.MarkFailed(url); err != nil {
+				logger.Warn("crawldb mark failed error", "url", url, "error", err)
+			}
 		}
+		return
+	}
 
-		title, desc, canonical := parseHTML(body)
+	fetchedAt := time.Now()
+	sum := sha256.Sum256(body)
+	sha256Hex := hex.EncodeToString(sum[:])
 
+	if db != nil {
+		if err := db.MarkDone(url, sha256Hex, job.LastMod, fetchedAt); err != nil {
+			logger.Warn("crawldb mark done error", "url", url, "error", err)
+		}
+	}
+
+	if !strings.Contains(ct, "text/html") {
 		results <- CrawlResult{
-			URL:             url,
-			Status:          status,
-			Title:           title,
-			MetaDescription: desc,
-			Canonical:       canonical,
+			URL:         url,
+			Status:      status,
+			ContentType: ct,
+			SHA256:      sha256Hex,
+			Body:        body,
+			FetchedAt:   fetchedAt,
+			LastMod:     job.LastMod,
+			ChangeFreq:  job.ChangeFreq,
+			Priority:    job.Priority,
+			Images:      job.Images,
+			NewsTitle:   job.NewsTitle,
+			Referrer:    job.Referrer,
 		}
+		return
+	}
+
+	title, desc, canonical := parseHTML(body)
+
+	results <- CrawlResult{
+		URL:             url,
+		Status:          status,
+		Title:           title,
+		MetaDescription: desc,
+		Canonical:       canonical,
+		ContentType:     ct,
+		SHA256:          sha256Hex,
+		Body:            body,
+		FetchedAt:       fetchedAt,
+		LastMod:         job.LastMod,
+		ChangeFreq:      job.ChangeFreq,
+		Priority:        job.Priority,
+		Images:          job.Images,
+		NewsTitle:       job.NewsTitle,
+		Referrer:        job.Referrer,
+	}
+
+	if follow == nil || job.Depth >= follow.MaxDepth {
+		return
+	}
 
-		time.Sleep(300 * time.Millisecond)
+	base, err := neturl.Parse(url)
+	if err != nil {
+		logger.Warn("base url parse error", "worker_id", id, "url", url, "error", err)
+		return
 	}
 
-	log.Println("WORKER STOPPED:", id)
+	for _, link := range extractLinks(body, base) {
+		if !follow.InScope(link) {
+			continue
+		}
+		if !follow.Visit(normalizeURL(link)) {
+			continue
+		}
+
+		jobWG.Add(1)
+		queue.Push(crawlJob{URL: link.String(), Depth: job.Depth + 1, Referrer: url})
+	}
 }
 
-func crawlSiteMap(sitemapURL string) error {
-	log.Println("START CRAWL:", sitemapURL)
+func crawlSiteMap(sitemapURL string, warcWriter *WarcWriter, db *crawldb.DB, refresh time.Duration, force bool, maxSitemapDepth int, follow *FollowConfig, contentStore *ContentStore) error {
+	logger.Info("crawl starting", "sitemap_url", sitemapURL)
+
+	visitedSitemaps := map[string]bool{sitemapURL: true}
 
-	data, _, _, err := makeRequest(sitemapURL)
+	data, _, _, err := makeRequest(sitemapURL, warcWriter, -1, 1)
 	if err != nil {
 		return err
 	}
 
 	data = sanitizeXML(data)
-	urls, err := extractURLsFromXML(data)
+	entries, err := extractURLsFromXML(data, warcWriter, 0, maxSitemapDepth, visitedSitemaps)
 	if err != nil {
 		return err
 	}
 
-	log.Println("TOTAL URLS DISCOVERED:", len(urls))
+	politeness := NewPoliteness(defaultMaxInFlightPerHost, warcWriter)
+
+	for _, sm := range politeness.Sitemaps(sitemapURL) {
+		if visitedSitemaps[sm] {
+			logger.Debug("robots sitemap already visited", "sitemap_url", sm)
+			continue
+		}
+		visitedSitemaps[sm] = true
+
+		logger.Info("robots sitemap seed", "sitemap_url", sm)
+
+		smData, _, _, err := makeRequest(sm, warcWriter, -1, 1)
+		if err != nil {
+			logger.Warn("robots sitemap fetch failed", "sitemap_url", sm, "error", err)
+			continue
+		}
+
+		smData = sanitizeXML(smData)
+		smEntries, err := extractURLsFromXML(smData, warcWriter, 0, maxSitemapDepth, visitedSitemaps)
+		if err != nil {
+			logger.Warn("robots sitemap parse failed", "sitemap_url", sm, "error", err)
+			continue
+		}
+
+		entries = append(entries, smEntries...)
+	}
+
+	if db != nil {
+		pending, err := db.PendingURLs()
+		if err != nil {
+			logger.Warn("crawldb pending lookup error", "error", err)
+		} else if len(pending) > 0 {
+			logger.Info("resuming pending urls", "count", len(pending))
+			for _, u := range pending {
+				entries = append(entries, sitemapEntry{URL: u})
+			}
+		}
+
+		if !force {
+			now := time.Now()
+			fresh := entries[:0]
+			for _, e := range entries {
+				skip, err := db.Fresh(e.URL, refresh, now)
+				if err != nil {
+					logger.Warn("crawldb freshness check error", "url", e.URL, "error", err)
+				}
+				if !skip {
+					skip, err = db.Unchanged(e.URL, e.LastMod)
+					if err != nil {
+						logger.Warn("crawldb unchanged check error", "url", e.URL, "error", err)
+					}
+				}
+				if skip {
+					logger.Debug("skipping unchanged or fresh url", "url", e.URL)
+					continue
+				}
+				fresh = append(fresh, e)
+			}
+			entries = fresh
+		}
+	}
+
+	logger.Info("urls discovered", "count", len(entries))
 
-	jobs := make(chan string, 100)
+	queue := newJobQueue()
 	results := make(chan CrawlResult, 100)
 
-	var wg sync.WaitGroup
+	var jobWG sync.WaitGroup
+	var workerWG sync.WaitGroup
 	workerCount := 5
 
-	log.Println("SPAWNING WORKERS:", workerCount)
+	logger.Info("spawning workers", "count", workerCount)
 
 	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go worker(i, jobs, results, &wg)
+		workerWG.Add(1)
+		go func(id int) {
+			defer workerWG.Done()
+			worker(id, queue, &jobWG, results, warcWriter, politeness, db, follow, force)
+		}(i)
 	}
 
-	go func() {
-		for _, url := range urls {
-			jobs <- url
+	for _, e := range entries {
+		if db != nil {
+			if err := db.MarkQueued(e.URL); err != nil {
+				logger.Warn("crawldb mark queued error", "url", e.URL, "error", err)
+			}
+		}
+
+		// Seed the follow dedup set with every sitemap URL too, not just
+		// links discovered on crawled pages, so a page linking back to a
+		// sitemap-seeded URL doesn't enqueue a second fetch of it.
+		if follow != nil {
+			if u, err := neturl.Parse(e.URL); err == nil {
+				follow.Visit(normalizeURL(u))
+			}
 		}
-		close(jobs)
+
+		jobWG.Add(1)
+		queue.Push(crawlJob{
+			URL:        e.URL,
+			Depth:      0,
+			LastMod:    e.LastMod,
+			ChangeFreq: e.ChangeFreq,
+			Priority:   e.Priority,
+			Images:     e.Images,
+			NewsTitle:  e.NewsTitle,
+		})
+	}
+
+	go func() {
+		jobWG.Wait()
+		queue.Close()
 	}()
 
 	go func() {
-		wg.Wait()
+		workerWG.Wait()
 		close(results)
 	}()
 
 	for res := range results {
-		log.Printf(
-			"RESULT | URL=%s STATUS=%d TITLE=%q DESC=%q CANONICAL=%q",
-			res.URL,
-			res.Status,
-			res.Title,
-			res.MetaDescription,
-			res.Canonical,
+		logger.Info("result",
+			"url", res.URL,
+			"status", res.Status,
+			"title", res.Title,
+			"description", res.MetaDescription,
+			"canonical", res.Canonical,
+			"referrer", res.Referrer,
 		)
+
+		if contentStore != nil && res.Body != nil {
+			if err := contentStore.Put(res.URL, res.Status, res.ContentType, res.SHA256, res.FetchedAt, res.Body); err != nil {
+				logger.Error("content store write failed", "url", res.URL, "error", err)
+			}
+		}
 	}
 
-	log.Println("CRAWL COMPLETE")
+	logger.Info("crawl complete")
 	return nil
 }
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	if len(os.Args) < 2 {
-		log.Println("usage: go run main.go <sitemap_url>")
+	warcPath := flag.String("warc", "", "write every fetched response to this WARC(.gz) file")
+	resume := flag.Bool("resume", false, "persist crawl state so an interrupted crawl can resume, and skip URLs fetched within -refresh")
+	force := flag.Bool("force", false, "with -resume, ignore persisted freshness and re-fetch every URL")
+	refresh := flag.Duration("refresh", 24*time.Hour, "with -resume, skip URLs fetched more recently than this")
+	dbPath := flag.String("db", "crawl.db", "crawldb state file used with -resume")
+	follow := flag.Bool("follow", false, "follow links discovered on fetched pages, subject to -depth/-schemes/-scope")
+	depth := flag.Int("depth", 2, "max link-following depth from each seed URL (with -follow)")
+	schemes := flag.String("schemes", "http,https", "comma-separated schemes allowed when following links")
+	scope := flag.String("scope", "", "regex restricting which discovered URLs are followed (default: same host as the seed)")
+	outDir := flag.String("outdir", "", "write fetched bodies to this content-addressed directory with a manifest.tsv")
+	dirLevels := flag.Int("dirlevels", 2, "nested two-character directory levels under -outdir")
+	logFormat := flag.String("log-format", "text", "structured log output format: json or text")
+	logLevel := flag.String("log-level", "info", "minimum log level: debug, info, warn, or error")
+	metricsAddr := flag.String("metrics", "", "expose Prometheus metrics on this address (e.g. :9090)")
+	sitemapDepth := flag.Int("sitemap-depth", defaultMaxSitemapDepth, "max nested sitemapindex levels to follow")
+	flag.Parse()
+
+	logger = newLogger(*logFormat, *logLevel)
+
+	args := flag.Args()
+	if len(args) < 1 {
+		log.Println("usage: go run . [-warc path] [-resume] [-force] [-refresh 24h] [-db crawl.db] [-follow] [-depth 2] [-schemes http,https] [-scope regex] [-outdir dir] [-dirlevels 2] [-log-format json|text] [-log-level info] [-metrics :9090] [-sitemap-depth 5] <sitemap_url>")
 		return
 	}
 
-	if err := crawlSiteMap(os.Args[1]); err != nil {
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr)
+	}
+
+	var warcWriter *WarcWriter
+	if *warcPath != "" {
+		w, err := NewWarcWriter(*warcPath)
+		if err != nil {
+			log.Println("WARC INIT ERROR:", err)
+			return
+		}
+		defer w.Close()
+		warcWriter = w
+	}
+
+	var db *crawldb.DB
+	if *resume {
+		d, err := crawldb.Open(*dbPath)
+		if err != nil {
+			log.Println("CRAWLDB OPEN ERROR:", err)
+			return
+		}
+		defer d.Close()
+		db = d
+	}
+
+	var followConfig *FollowConfig
+	if *follow {
+		fc, err := NewFollowConfig(args[0], *depth, *schemes, *scope)
+		if err != nil {
+			log.Println("FOLLOW CONFIG ERROR:", err)
+			return
+		}
+		followConfig = fc
+	}
+
+	var contentStore *ContentStore
+	if *outDir != "" {
+		cs, err := NewContentStore(*outDir, *dirLevels)
+		if err != nil {
+			log.Println("CONTENT STORE INIT ERROR:", err)
+			return
+		}
+		defer cs.Close()
+		contentStore = cs
+	}
+
+	if err := crawlSiteMap(args[0], warcWriter, db, *refresh, *force, *sitemapDepth, followConfig, contentStore); err != nil {
 		log.Println("FATAL ERROR:", err)
 	}
 }
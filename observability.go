@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// logger is the structured logger used by the request/worker/crawl hot
+// path; newLogger reconfigures it from the -log-format/-log-level flags
+// once main() has parsed them.
+var logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+// newLogger builds a structured logger writing format ("json" or
+// "text") at the given level ("debug", "info", "warn", "error").
+func newLogger(format, level string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	return slog.New(handler)
+}
+
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "crawler_requests_total",
+			Help: "Total HTTP requests made by the crawler, by response status.",
+		},
+		[]string{"status"},
+	)
+
+	bytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_bytes_total",
+		Help: "Total bytes read from HTTP responses.",
+	})
+
+	requestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "crawler_request_duration_seconds",
+		Help:    "HTTP request duration in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "crawler_queue_depth",
+		Help: "Number of crawl jobs currently waiting in the queue.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, bytesTotal, requestDuration, queueDepth)
+}
+
+// recordRequestMetrics updates the Prometheus series for one completed
+// HTTP request.
+func recordRequestMetrics(status int, bytesRead int, duration time.Duration) {
+	requestsTotal.WithLabelValues(strconv.Itoa(status)).Inc()
+	bytesTotal.Add(float64(bytesRead))
+	requestDuration.Observe(duration.Seconds())
+}
+
+// serveMetrics starts a background HTTP server exposing Prometheus
+// metrics at addr (e.g. ":9090") for the duration of the process.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("metrics server stopped", "error", err, "addr", addr)
+		}
+	}()
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsUserAgent is the token we match robots.txt groups against.
+	// The crawler rotates browser-like User-Agent strings per request, so
+	// rather than chase a name no site will recognize, we honor whatever
+	// a site publishes for "*".
+	robotsUserAgent = "*"
+
+	defaultCrawlDelay        = 1 * time.Second
+	defaultMaxInFlightPerHost = 2
+
+	// StatusRobotsDisallowed is a synthetic CrawlResult.Status reported
+	// for URLs skipped because robots.txt disallows them. It does not
+	// correspond to any real HTTP status code.
+	StatusRobotsDisallowed = -1
+)
+
+type hostRules struct {
+	disallow []string
+	allow    []string
+	delay    time.Duration
+	sitemaps []string
+}
+
+// allowed reports whether path may be fetched, using the de-facto
+// longest-matching-rule convention when both Allow and Disallow apply.
+func (r *hostRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+
+	allowLen, disallowLen := -1, -1
+	for _, p := range r.allow {
+		if strings.HasPrefix(path, p) && len(p) > allowLen {
+			allowLen = len(p)
+		}
+	}
+	for _, p := range r.disallow {
+		if strings.HasPrefix(path, p) && len(p) > disallowLen {
+			disallowLen = len(p)
+		}
+	}
+	return disallowLen <= allowLen
+}
+
+type hostState struct {
+	sem       chan struct{}
+	mu        sync.Mutex
+	lastFetch time.Time
+	rules     *hostRules
+	fetched   bool
+}
+
+// Politeness tracks per-host robots.txt rules and enforces per-host rate
+// limits so crawlSiteMap stays a well-behaved visitor of the sites it
+// crawls.
+type Politeness struct {
+	mu          sync.Mutex
+	hosts       map[string]*hostState
+	maxInFlight int
+	warcWriter  *WarcWriter
+}
+
+// NewPoliteness returns a Politeness that allows at most maxInFlight
+// concurrent requests per host, archiving its own robots.txt fetches to
+// warcWriter if one is configured.
+func NewPoliteness(maxInFlight int, warcWriter *WarcWriter) *Politeness {
+	if maxInFlight < 1 {
+		maxInFlight = defaultMaxInFlightPerHost
+	}
+	return &Politeness{
+		hosts:       make(map[string]*hostState),
+		maxInFlight: maxInFlight,
+		warcWriter:  warcWriter,
+	}
+}
+
+func (p *Politeness) stateFor(host string) *hostState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hs, ok := p.hosts[host]
+	if !ok {
+		hs = &hostState{sem: make(chan struct{}, p.maxInFlight)}
+		p.hosts[host] = hs
+	}
+	return hs
+}
+
+// ensureRules fetches and parses robots.txt for u's host the first time
+// it's seen, caching the result (including failures, as "no rules") for
+// subsequent lookups.
+func (p *Politeness) ensureRules(u *url.URL) *hostRules {
+	hs := p.stateFor(u.Host)
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.fetched {
+		return hs.rules
+	}
+	hs.fetched = true
+
+	robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+	logger.Info("robots fetch", "url", robotsURL)
+
+	data, _, status, err := makeRequest(robotsURL, p.warcWriter, -1, 1)
+	if err != nil || status >= 400 {
+		hs.rules = nil
+		return nil
+	}
+
+	hs.rules = parseRobots(data, robotsUserAgent)
+	return hs.rules
+}
+
+// Allowed reports whether rawURL may be fetched under its host's
+// robots.txt rules, fetching and caching those rules on first use.
+func (p *Politeness) Allowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+
+	rules := p.ensureRules(u)
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return rules.allowed(path)
+}
+
+// Delay returns the minimum gap to leave between requests to host,
+// honoring a Crawl-delay directive when the site publishes one.
+func (p *Politeness) Delay(host string) time.Duration {
+	hs := p.stateFor(host)
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.rules != nil && hs.rules.delay > 0 {
+		return hs.rules.delay
+	}
+	return defaultCrawlDelay
+}
+
+// Sitemaps returns any `Sitemap:` directives discovered in rawURL's
+// host's robots.txt.
+func (p *Politeness) Sitemaps(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	rules := p.ensureRules(u)
+	if rules == nil {
+		return nil
+	}
+	return rules.sitemaps
+}
+
+// Acquire blocks until a request to rawURL's host may proceed without
+// exceeding the per-host in-flight limit or violating its crawl delay. It
+// acts as a per-host token bucket: the semaphore caps concurrency, and
+// the timestamp check paces requests over time. The caller must invoke
+// the returned release func once the request completes.
+func (p *Politeness) Acquire(rawURL string) (func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	hs := p.stateFor(u.Host)
+	hs.sem <- struct{}{}
+
+	// Delay locks hs.mu itself, so its result must be computed before we
+	// take the lock below; calling it while holding hs.mu would deadlock
+	// on the non-reentrant mutex.
+	delay := p.Delay(u.Host)
+
+	hs.mu.Lock()
+	if wait := delay - time.Since(hs.lastFetch); wait > 0 {
+		hs.mu.Unlock()
+		time.Sleep(wait)
+		hs.mu.Lock()
+	}
+	hs.lastFetch = time.Now()
+	hs.mu.Unlock()
+
+	return func() { <-hs.sem }, nil
+}
+
+// parseRobots extracts the Disallow/Allow/Crawl-delay rules of every group
+// whose User-agent is "*" or userAgent (rules of both are merged) plus any
+// Sitemap directives, which apply regardless of the requesting agent.
+func parseRobots(data []byte, userAgent string) *hostRules {
+	rules := &hostRules{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	matching := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			matching = value == "*" || strings.EqualFold(value, userAgent)
+		case "disallow":
+			if matching && value != "" {
+				rules.disallow = append(rules.disallow, value)
+			}
+		case "allow":
+			if matching && value != "" {
+				rules.allow = append(rules.allow, value)
+			}
+		case "crawl-delay":
+			if matching {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil {
+					rules.delay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			rules.sitemaps = append(rules.sitemaps, value)
+		}
+	}
+
+	return rules
+}
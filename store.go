@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ContentStore writes fetched bodies to a content-addressed directory
+// tree and appends a manifest line for every fetch. Because the path is
+// derived from the body's own hash, identical bodies served from
+// different URLs (duplicate 404 pages, mirrored assets, ...) land on the
+// same file for free. Every method must be called from a single
+// goroutine, since the manifest file is not safe for concurrent writes.
+type ContentStore struct {
+	rootDir   string
+	dirLevels int
+	manifest  *os.File
+	writer    *bufio.Writer
+}
+
+// NewContentStore creates rootDir and its manifest.tsv if they don't
+// already exist. dirLevels controls how many nested two-character
+// directories are derived from each body's hash (outdir/ab/cd/<hash>).
+func NewContentStore(rootDir string, dirLevels int) (*ContentStore, error) {
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return nil, fmt.Errorf("contentstore: mkdir %s: %w", rootDir, err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(rootDir, "manifest.tsv"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("contentstore: open manifest: %w", err)
+	}
+
+	return &ContentStore{
+		rootDir:   rootDir,
+		dirLevels: dirLevels,
+		manifest:  f,
+		writer:    bufio.NewWriter(f),
+	}, nil
+}
+
+// Close flushes and closes the manifest file.
+func (s *ContentStore) Close() error {
+	if err := s.writer.Flush(); err != nil {
+		s.manifest.Close()
+		return err
+	}
+	return s.manifest.Close()
+}
+
+// Put writes body to its content-addressed path, reusing the existing
+// file if another URL already produced the same hash, then appends and
+// flushes a manifest line so a crash preserves partial progress.
+func (s *ContentStore) Put(url string, status int, contentType, sha256Hex string, fetchedAt time.Time, body []byte) error {
+	path := s.contentPath(sha256Hex)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("contentstore: mkdir %s: %w", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, body, 0644); err != nil {
+			return fmt.Errorf("contentstore: write %s: %w", path, err)
+		}
+	}
+
+	line := fmt.Sprintf("%s\t%d\t%s\t%s\t%s\n", url, status, contentType, sha256Hex, fetchedAt.UTC().Format(time.RFC3339))
+	if _, err := s.writer.WriteString(line); err != nil {
+		return fmt.Errorf("contentstore: write manifest entry for %s: %w", url, err)
+	}
+	return s.writer.Flush()
+}
+
+// contentPath splits the leading hex characters of sha256Hex into
+// dirLevels nested two-character directories under rootDir, e.g.
+// rootDir/ab/cd/abcdef0123....
+func (s *ContentStore) contentPath(sha256Hex string) string {
+	parts := make([]string, 0, s.dirLevels+1)
+	for i := 0; i < s.dirLevels && i*2+2 <= len(sha256Hex); i++ {
+		parts = append(parts, sha256Hex[i*2:i*2+2])
+	}
+	parts = append(parts, sha256Hex)
+	return filepath.Join(s.rootDir, filepath.Join(parts...))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WarcWriter serializes fetched HTTP exchanges into a WARC file. Each
+// record is gzip-compressed as its own gzip member, matching the
+// member-per-record convention of WARC.gz so the output is readable by
+// pywb/wayback tooling, and records completed before an interrupted crawl
+// stay intact; a record cut off mid-write is left as a truncated member.
+type WarcWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewWarcWriter opens (creating if necessary) the WARC file at path and
+// writes the leading warcinfo record.
+func NewWarcWriter(path string) (*WarcWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WarcWriter{file: f}
+	if err := w.writeWarcinfo(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Close flushes and closes the underlying WARC file.
+func (w *WarcWriter) Close() error {
+	return w.file.Close()
+}
+
+// WriteRequest emits a WARC `request` record describing the outgoing
+// fetch for url and returns its WARC-Record-ID so the matching response
+// record can reference it via WARC-Concurrent-To.
+func (w *WarcWriter) WriteRequest(url, userAgent string) (string, error) {
+	recordID := newRecordID()
+	block := []byte(fmt.Sprintf(
+		"GET %s HTTP/1.1\r\nUser-Agent: %s\r\nAccept: application/xml,text/xml,text/html,*/*\r\n\r\n",
+		url, userAgent,
+	))
+
+	headers := []string{
+		"WARC-Type: request",
+		"WARC-Record-ID: " + recordID,
+		"WARC-Date: " + warcDate(),
+		"WARC-Target-URI: " + url,
+		"Content-Type: application/http; msgtype=request",
+		"Content-Length: " + strconv.Itoa(len(block)),
+		"WARC-Block-Digest: " + blockDigest(block),
+	}
+	return recordID, w.writeRecord(headers, block)
+}
+
+// WriteResponse emits a WARC `response` record for url, reconstructing the
+// raw HTTP status line, headers and body from resp and body (the
+// already-read response body, as received and before any decompression
+// of .gz URLs). requestID ties the record
+// back to the preceding request record via WARC-Concurrent-To.
+func (w *WarcWriter) WriteResponse(url, requestID string, resp *http.Response, body []byte) error {
+	var raw bytes.Buffer
+	fmt.Fprintf(&raw, "HTTP/1.1 %s\r\n", resp.Status)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			fmt.Fprintf(&raw, "%s: %s\r\n", k, v)
+		}
+	}
+	raw.WriteString("\r\n")
+	raw.Write(body)
+	block := raw.Bytes()
+
+	headers := []string{
+		"WARC-Type: response",
+		"WARC-Record-ID: " + newRecordID(),
+		"WARC-Date: " + warcDate(),
+		"WARC-Target-URI: " + url,
+		"WARC-Concurrent-To: " + requestID,
+		"Content-Type: application/http; msgtype=response",
+		"Content-Length: " + strconv.Itoa(len(block)),
+		"WARC-Block-Digest: " + blockDigest(block),
+	}
+	return w.writeRecord(headers, block)
+}
+
+func (w *WarcWriter) writeWarcinfo() error {
+	block := []byte("software: web-crawler\r\nformat: WARC File Format 1.0\r\n")
+	headers := []string{
+		"WARC-Type: warcinfo",
+		"WARC-Record-ID: " + newRecordID(),
+		"WARC-Date: " + warcDate(),
+		"Content-Type: application/warc-fields",
+		"Content-Length: " + strconv.Itoa(len(block)),
+	}
+	return w.writeRecord(headers, block)
+}
+
+// writeRecord assembles one WARC record (headers, blank line, block, and
+// the trailing CRLF CRLF separator) and gzips it as a standalone member.
+// Writes are serialized behind mu since workers fetch concurrently.
+func (w *WarcWriter) writeRecord(headers []string, block []byte) error {
+	var rec bytes.Buffer
+	rec.WriteString("WARC/1.0\r\n")
+	for _, h := range headers {
+		rec.WriteString(h)
+		rec.WriteString("\r\n")
+	}
+	rec.WriteString("\r\n")
+	rec.Write(block)
+	rec.WriteString("\r\n\r\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	gz := gzip.NewWriter(w.file)
+	if _, err := gz.Write(rec.Bytes()); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+func warcDate() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func blockDigest(block []byte) string {
+	sum := sha1.Sum(block)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func newRecordID() string {
+	return fmt.Sprintf("<urn:uuid:%s>", newUUID())
+}
+
+// newUUID generates a random (version 4) UUID without pulling in an
+// external dependency.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand failing would mean the platform's entropy source is
+		// broken; fall back to a timestamp-derived ID rather than aborting
+		// the crawl over a non-essential record identifier.
+		return fmt.Sprintf("%016x-0000-4000-8000-000000000000", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}